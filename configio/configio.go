@@ -0,0 +1,60 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+// Package configio decodes TOML/YAML configuration documents and
+// validates them against a base_modules.ParameterSchema. It is kept
+// separate from the modules package so that package can build with only
+// the standard library; this one pulls in third-party TOML/YAML decoders.
+package configio
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	base_modules "github.com/brunoga/go-modules"
+)
+
+// Format identifies the encoding ParseReader should decode its input as.
+type Format int
+
+const (
+	TOML Format = iota
+	YAML
+)
+
+// ParseReader decodes r (encoded as format) into a map[string]any and
+// validates it against schema via schema.ParseMap - so an Enum value
+// must still be one of EnumValues and Int/Bool/Duration values are
+// coerced the same way ParseMap's other callers are.
+func ParseReader(schema base_modules.ParameterSchema, r io.Reader, format Format) (map[string]any, error) {
+	raw := make(map[string]any)
+
+	switch format {
+	case TOML:
+		if _, err := toml.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, fmt.Errorf("decoding TOML configuration : %w", err)
+		}
+	case YAML:
+		if err := yaml.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, fmt.Errorf("decoding YAML configuration : %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported configuration format %v", format)
+	}
+
+	return schema.ParseMap(raw)
+}
@@ -0,0 +1,191 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package modules
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ModuleRef identifies a specific module instance (by GenericId and
+// SpecificId, see Module) that a DependentModule requires to be registered
+// and Ready before it can be registered itself.
+type ModuleRef struct {
+	GenericId  string
+	SpecificId string
+}
+
+// DependentModule is an optional interface a Module can implement to
+// declare other modules it requires. RegisterModule uses it to defer
+// registration of a module until all of its declared dependencies are
+// themselves registered and Ready, so modules can be composed (as complete-module
+// does in the examples) without having to hand-order init() calls.
+type DependentModule interface {
+	Module
+
+	// Dependencies returns the ModuleRefs this module requires to be
+	// registered and Ready before it can be registered itself.
+	Dependencies() []ModuleRef
+}
+
+// moduleKey uniquely identifies a module instance by its generic and
+// specific ids.
+type moduleKey struct {
+	genericId  string
+	specificId string
+}
+
+// pendingModules holds modules that were passed to RegisterModule but
+// whose declared dependencies were not all satisfied yet.
+var pendingModules FullModuleMap
+
+func init() {
+	pendingModules = make(FullModuleMap)
+}
+
+// dependenciesOf returns the ModuleRefs module depends on, or nil if module
+// does not implement DependentModule.
+func dependenciesOf(module Module) []ModuleRef {
+	dependentModule, ok := module.(DependentModule)
+	if !ok {
+		return nil
+	}
+
+	return dependentModule.Dependencies()
+}
+
+// dependenciesSatisfied returns true if every ModuleRef in refs is already
+// a registered module that is Ready.
+func dependenciesSatisfied(refs []ModuleRef) bool {
+	for _, ref := range refs {
+		module, ok := registeredModulesById[ref.GenericId][ref.SpecificId]
+		if !ok || !module.Ready() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ResolveAll performs a topological sort (Kahn's algorithm) over every
+// pending module - modules passed to RegisterModule whose dependencies
+// were not satisfied at the time - and registers them in dependency
+// order. It returns an error naming the offending ids if some pending
+// modules form a dependency cycle, depend on a module that is never
+// registered, or depend on a registered module that is not Ready.
+func ResolveAll() error {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	remaining := drainPending()
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(remaining))
+	for _, key := range remaining {
+		ids = append(ids, fmt.Sprintf("%s/%s", key.genericId, key.specificId))
+	}
+	sort.Strings(ids)
+
+	return fmt.Errorf("dependency cycle (or missing dependency) detected among pending modules : %v", ids)
+}
+
+// drainPending repeatedly registers every pending module whose
+// dependencies have become satisfied until no more progress can be made.
+// It returns the keys of whatever modules are still pending afterwards.
+// It assumes modulesLock is already held for writing.
+func drainPending() []moduleKey {
+	for progress := true; progress; {
+		progress = false
+
+		for genericId, moduleMap := range pendingModules {
+			for specificId, module := range moduleMap {
+				if !dependenciesSatisfied(dependenciesOf(module)) {
+					continue
+				}
+
+				delete(pendingModules[genericId], specificId)
+				if len(pendingModules[genericId]) == 0 {
+					delete(pendingModules, genericId)
+				}
+
+				insertModuleLocked(module)
+				progress = true
+			}
+		}
+	}
+
+	var remaining []moduleKey
+	for genericId, moduleMap := range pendingModules {
+		for specificId := range moduleMap {
+			remaining = append(remaining, moduleKey{genericId, specificId})
+		}
+	}
+
+	return remaining
+}
+
+// attemptDrainPendingAfterReady tries to register any pending modules
+// whose dependencies are satisfied now that a module's ready status has
+// changed. It is called by GenericModule.SetReady, since
+// dependenciesSatisfied requires a dependency to be Ready, not just
+// registered. Any remaining cycle (or missing dependency) is left for a
+// caller of ResolveAll to report; this best-effort drain does not
+// surface it.
+//
+// It uses TryLock rather than Lock because SetReady can be called from
+// inside a module's own Register() - the natural place for a module with
+// no separate Configure step to mark itself ready - which runs with
+// modulesLock already held for writing (see insertModuleLocked).
+// sync.RWMutex is not reentrant, so blocking for the lock here would
+// deadlock that caller; in that case the holder (registerModuleLocked or
+// drainPending's own caller) drains pending modules again before
+// releasing it. TryLock also fails when any other holder has the lock at
+// that moment (for example a concurrent GetAllModules or
+// UnregisterModule); the drain is then skipped as well, and the modules
+// stay pending until the next RegisterModule, SetReady(true) or
+// ResolveAll call.
+func attemptDrainPendingAfterReady() {
+	if !modulesLock.TryLock() {
+		return
+	}
+	defer modulesLock.Unlock()
+
+	drainPending()
+}
+
+// findDependents returns every registered module that declares (via
+// DependentModule) a dependency on module. It assumes modulesLock is
+// already held.
+func findDependents(module Module) []Module {
+	var dependents []Module
+
+	genericId := module.GenericId()
+	specificId := module.SpecificId()
+
+	for _, moduleMap := range registeredModulesById {
+		for _, candidate := range moduleMap {
+			for _, ref := range dependenciesOf(candidate) {
+				if ref.GenericId == genericId && ref.SpecificId == specificId {
+					dependents = append(dependents, candidate)
+					break
+				}
+			}
+		}
+	}
+
+	return dependents
+}
@@ -0,0 +1,140 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package modules
+
+import (
+	"sync"
+)
+
+// EventKind identifies the kind of change an Event represents.
+type EventKind int
+
+const (
+	// Registered is emitted when a module is added to the registry.
+	Registered EventKind = iota
+
+	// Unregistered is emitted when a module is removed from the registry.
+	Unregistered
+
+	// Configured is emitted when a module's Configure method is called.
+	Configured
+
+	// ReadyChanged is emitted when a module's ready status changes (see
+	// GenericModule.SetReady).
+	ReadyChanged
+)
+
+// Event describes a single change to the module registry or to an
+// individual module's state.
+type Event struct {
+	Kind   EventKind
+	Module Module
+}
+
+// Filter selects which Events a Subscribe call receives. A zero Filter
+// matches every Event. Type and GenericId, when non-empty, must match the
+// associated Module exactly; Predicate, when set, is consulted in addition
+// to (not instead of) them.
+type Filter struct {
+	Type      string
+	GenericId string
+	Predicate func(Module) bool
+}
+
+// matches returns true if module satisfies every criteria set on f.
+func (f Filter) matches(module Module) bool {
+	if f.Type != "" && f.Type != module.Type() {
+		return false
+	}
+	if f.GenericId != "" && f.GenericId != module.GenericId() {
+		return false
+	}
+	if f.Predicate != nil && !f.Predicate(module) {
+		return false
+	}
+
+	return true
+}
+
+// CancelFunc unsubscribes a previously created Subscribe call and closes
+// its channel. It is safe to call more than once.
+type CancelFunc func()
+
+// subscriberChannelSize is the buffer size used for every subscriber
+// channel. Publishing never blocks on a slow subscriber; events are
+// dropped instead (see publish).
+const subscriberChannelSize = 16
+
+type subscription struct {
+	filter Filter
+	ch     chan Event
+}
+
+var (
+	subscriptionsLock  sync.Mutex
+	subscriptions      = make(map[int]*subscription)
+	nextSubscriptionId int
+)
+
+// Subscribe registers interest in registry and module events matching
+// filter. It returns a channel that receives every matching Event and a
+// CancelFunc that must be called once the subscriber is done, to release
+// the channel. A subscriber that does not keep up with events may miss
+// some; Subscribe favors not blocking callers (RegisterModule,
+// UnregisterModule, Configure, SetReady) over guaranteed delivery.
+func Subscribe(filter Filter) (<-chan Event, CancelFunc) {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+
+	id := nextSubscriptionId
+	nextSubscriptionId++
+
+	sub := &subscription{
+		filter: filter,
+		ch:     make(chan Event, subscriberChannelSize),
+	}
+	subscriptions[id] = sub
+
+	return sub.ch, func() {
+		subscriptionsLock.Lock()
+		defer subscriptionsLock.Unlock()
+
+		if existing, ok := subscriptions[id]; ok {
+			delete(subscriptions, id)
+			close(existing.ch)
+		}
+	}
+}
+
+// publish fans an Event for (kind, module) out to every subscription whose
+// Filter matches it, dropping it for subscribers whose channel is full.
+func publish(kind EventKind, module Module) {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+
+	event := Event{Kind: kind, Module: module}
+	for _, sub := range subscriptions {
+		if !sub.filter.matches(module) {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			// Subscriber is not keeping up; drop rather than block
+			// the caller that triggered this event.
+		}
+	}
+}
@@ -38,6 +38,23 @@ func (cm *CompleteModule) Parameters() *base_modules.ParameterMap {
 	}
 }
 
+func (cm *CompleteModule) Schema() base_modules.ParameterSchema {
+	return base_modules.ParameterSchema{
+		{
+			Name:        "text1",
+			Type:        base_modules.String,
+			Required:    true,
+			Description: "Text to print as the first line of output.",
+		},
+		{
+			Name:        "text2",
+			Type:        base_modules.String,
+			Default:     "Default text",
+			Description: "Text to print as the second line of output.",
+		},
+	}
+}
+
 func (cm *CompleteModule) Configure(parameters *base_modules.ParameterMap) error {
 	text1Parameter, ok := (*parameters)["text1"]
 	if !ok {
@@ -46,6 +63,13 @@ func (cm *CompleteModule) Configure(parameters *base_modules.ParameterMap) error
 
 	text2Parameter := (*parameters)["text2"]
 
+	// Delegate to GenericModule.Configure so it records parameters and
+	// publishes Configured, same as a module that does not override
+	// Configure at all.
+	if err := cm.GenericModule.Configure(parameters); err != nil {
+		return err
+	}
+
 	cm.text1 = text1Parameter
 	cm.text2 = text2Parameter
 
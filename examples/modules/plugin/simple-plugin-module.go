@@ -18,15 +18,20 @@ import (
 	base_modules "github.com/brunoga/go-modules"
 )
 
-var ModuleApiVersion = 1
+var ModuleApiVersion = base_modules.ApiVersion
 
 type SimplePluginModule struct {
 	*base_modules.GenericModule
 }
 
-func init() {
-	base_modules.RegisterModule(&SimplePluginModule{
+// Modules is the symbol the plugin package's loader looks up (see
+// plugin.LoadPlugin) to get the Modules this plugin provides. It is not
+// registered here : the loader is responsible for calling
+// base_modules.RegisterModule on each of them, so a plugin does not also
+// register itself via init() and end up registered twice.
+var Modules = []base_modules.Module{
+	&SimplePluginModule{
 		base_modules.NewGenericModule("Simple Plugin Module", "1.0.0",
 			"simple-plugin-module", "", "sample-module"),
-	})
+	},
 }
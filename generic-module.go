@@ -28,6 +28,12 @@ type GenericModule struct {
 	moduleType string
 	parameters *ParameterMap
 	ready      bool
+	metadata   ModuleMetadata
+
+	// self is the outer Module gm is embedded in, set by RegisterModule
+	// via setSelf so Configure and SetReady can publish events carrying
+	// it instead of gm itself. It is nil until the module is registered.
+	self Module
 }
 
 // NewGenericModule creates and returns a new GenericModule.
@@ -43,6 +49,16 @@ func NewGenericModule(name, version, genericId, specificId, moduleType string) *
 	}
 }
 
+// NewGenericModuleWithMetadata creates and returns a new GenericModule with
+// the given ModuleMetadata (license, author, homepage, ...) attached. See
+// Metadata.
+func NewGenericModuleWithMetadata(name, version, genericId, specificId, moduleType string, metadata ModuleMetadata) *GenericModule {
+	gm := NewGenericModule(name, version, genericId, specificId, moduleType)
+	gm.metadata = metadata
+
+	return gm
+}
+
 func (gm *GenericModule) Name() string {
 	return gm.name
 }
@@ -59,6 +75,30 @@ func (gm *GenericModule) SpecificId() string {
 	return gm.specificId
 }
 
+// setSpecificId changes the module's specific id. It is unexported and
+// only meant to be used by MutatorContext.Rename.
+func (gm *GenericModule) setSpecificId(specificId string) {
+	gm.specificId = specificId
+}
+
+// setSelf records self (the outer Module gm is embedded in) so Configure
+// and SetReady can publish it instead of gm. It is unexported and only
+// meant to be called by insertModuleLocked.
+func (gm *GenericModule) setSelf(self Module) {
+	gm.self = self
+}
+
+// eventModule returns the Module that should be published in this
+// instance's Configured and ReadyChanged events : self if the module has
+// been registered, otherwise gm itself.
+func (gm *GenericModule) eventModule() Module {
+	if gm.self != nil {
+		return gm.self
+	}
+
+	return gm
+}
+
 func (gm *GenericModule) Type() string {
 	return gm.moduleType
 }
@@ -75,8 +115,23 @@ func (gm *GenericModule) Parameters() *ParameterMap {
 	return gm.parameters
 }
 
+// Schema returns the ParameterSchema describing this module's
+// configuration options. GenericModule declares none; embedders that
+// accept configuration should override this.
+func (gm *GenericModule) Schema() ParameterSchema {
+	return nil
+}
+
+// Metadata returns the license and provenance information attached to
+// this module (see NewGenericModuleWithMetadata). It is the zero
+// ModuleMetadata if none was attached.
+func (gm *GenericModule) Metadata() ModuleMetadata {
+	return gm.metadata
+}
+
 func (gm *GenericModule) Configure(parameters *ParameterMap) error {
 	gm.parameters = parameters
+	publish(Configured, gm.eventModule())
 	return nil
 }
 
@@ -88,7 +143,14 @@ func (gm *GenericModule) Ready() bool {
 	return gm.ready
 }
 
-// SetReady allows setting the ready status of the module.
+// SetReady allows setting the ready status of the module. Becoming ready
+// may satisfy other pending modules' dependencies (see DependentModule),
+// so it also tries to make progress on them.
 func (gm *GenericModule) SetReady(ready bool) {
 	gm.ready = ready
+	publish(ReadyChanged, gm.eventModule())
+
+	if ready {
+		attemptDrainPendingAfterReady()
+	}
 }
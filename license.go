@@ -0,0 +1,123 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package modules
+
+import "fmt"
+
+// ModuleMetadata carries license and provenance information about a
+// Module, as attached via NewGenericModuleWithMetadata.
+type ModuleMetadata struct {
+	// License is the module's SPDX license identifier (for example,
+	// "Apache-2.0"). Empty means unspecified.
+	License string
+
+	// LicenseFiles lists paths (relative to the module's source) to the
+	// license text backing License.
+	LicenseFiles []string
+
+	Author    string
+	Homepage  string
+	SourceURL string
+}
+
+// Policy describes which SPDX license ids RegisterModule allows. If
+// Allowlist is non-empty, only ids in it are allowed and Denylist is
+// ignored; otherwise, every id not in Denylist is allowed. A module with
+// an empty License (metadata is optional) is always allowed.
+type Policy struct {
+	Allowlist []string
+	Denylist  []string
+
+	// OnViolation, if set, is called (in addition to RegisterModule
+	// returning an error) whenever a module is refused due to its
+	// license.
+	OnViolation func(module Module, license string)
+}
+
+// allows returns true if license is permitted by p.
+func (p Policy) allows(license string) bool {
+	if license == "" {
+		return true
+	}
+
+	if len(p.Allowlist) > 0 {
+		for _, allowed := range p.Allowlist {
+			if allowed == license {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, denied := range p.Denylist {
+		if denied == license {
+			return false
+		}
+	}
+
+	return true
+}
+
+// licensePolicy is the Policy RegisterModule consults. The zero Policy
+// allows everything.
+var licensePolicy Policy
+
+// licenseViolationError signals that registerModuleLocked refused module
+// because of its license. RegisterModule type-asserts for it so it can
+// call Policy.OnViolation after releasing modulesLock instead of from
+// inside registerModuleLocked.
+type licenseViolationError struct {
+	module  Module
+	license string
+}
+
+func (e *licenseViolationError) Error() string {
+	return fmt.Sprintf("module %q/%q license %q is not allowed by the current policy",
+		e.module.GenericId(), e.module.SpecificId(), e.license)
+}
+
+// SetLicensePolicy installs policy as the allowlist/denylist RegisterModule
+// consults against every module's Metadata().License.
+func SetLicensePolicy(policy Policy) {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	licensePolicy = policy
+}
+
+// GetModulesByLicense returns a FullModuleMap of every registered module
+// whose Metadata().License equals spdxID, for producing an SBOM-style
+// listing of what is loaded into the process.
+func GetModulesByLicense(spdxID string) FullModuleMap {
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
+	result := make(FullModuleMap)
+	for genericId, moduleMap := range registeredModulesById {
+		for specificId, module := range moduleMap {
+			if module.Metadata().License != spdxID {
+				continue
+			}
+
+			if result[genericId] == nil {
+				result[genericId] = make(ModuleMap)
+			}
+			result[genericId][specificId] = module
+		}
+	}
+
+	return result
+}
@@ -21,9 +21,20 @@
 package modules
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 )
 
+// ApiVersion identifies the version of this package's plugin-facing API
+// (the Module interface and friends). Out-of-tree plugins (see the
+// plugin subpackage) export their own ModuleApiVersion so it can be
+// checked against this value before they are loaded. Bump it whenever
+// Module gains or changes a required method, so plugins built against the
+// old shape are refused instead of silently loaded.
+const ApiVersion = 2
+
 // ParameterMap defines a list of parameters used for configuring a module.
 type ParameterMap map[string]string
 
@@ -78,6 +89,19 @@ type Module interface {
 	// configuration options.
 	Configure(params *ParameterMap) error
 
+	// Schema returns the ParameterSchema describing this module's
+	// configuration options - their types, defaults, whether they are
+	// required and how to validate them. It is the typed counterpart to
+	// Parameters() and is what ParameterSchema.ParseParameterMap,
+	// ParameterSchema.ParseMap and configio.ParseReader validate
+	// configuration against.
+	Schema() ParameterSchema
+
+	// Metadata returns the license and provenance information (SPDX
+	// license id, author, homepage, ...) associated with this module. See
+	// ModuleMetadata.
+	Metadata() ModuleMetadata
+
 	// Duplicate creates and registers a new instance of this module with
 	// the given specific id. Returns a reference to the new Module and a
 	// nil error on success and a non-nil error on failure. Note that
@@ -92,6 +116,12 @@ type Module interface {
 	Ready() bool
 }
 
+// ErrIdCollision is the sentinel wrapped by the error registerModuleLocked
+// returns when a module's GenericId/SpecificId pair is already registered
+// or pending. Callers outside this package (e.g. the plugin subpackage)
+// should match it with errors.Is rather than inspecting Error() text.
+var ErrIdCollision = errors.New("id collision detected")
+
 // ModuleMap is a container for Modules keyed by specific id.
 type ModuleMap map[string]Module
 
@@ -104,25 +134,99 @@ var registeredModulesByType map[string]FullModuleMap
 // registeredModulesById is a per id container for all registered modules.
 var registeredModulesById FullModuleMap
 
+// modulesLock guards registeredModulesByType, registeredModulesById and
+// pendingModules (see dependencies.go). Every exported function that reads
+// or mutates them takes it; internal helpers whose name ends in "Locked"
+// assume it is already held.
+var modulesLock sync.RWMutex
+
 func init() {
 	registeredModulesByType = make(map[string]FullModuleMap)
 	registeredModulesById = make(FullModuleMap)
 }
 
-// RegisterModule registers a new module for usage.
+// RegisterModule registers a new module for usage. If module implements
+// DependentModule and some of its declared Dependencies() are not
+// registered and Ready yet, registration (and the Register() call) is
+// deferred until they are - either because they get registered and become
+// Ready later and a subsequent RegisterModule, SetReady(true) or ResolveAll
+// call unblocks it, or because ResolveAll is called explicitly and reports
+// a dependency cycle.
 func RegisterModule(module Module) error {
+	modulesLock.Lock()
+	err := registerModuleLocked(module)
+	modulesLock.Unlock()
+
+	// Policy.OnViolation is invoked outside modulesLock since it is
+	// arbitrary user code that may itself call back into this package
+	// (e.g. GetModulesByLicense) - calling it while still holding the
+	// lock would deadlock.
+	if violation, ok := err.(*licenseViolationError); ok {
+		modulesLock.RLock()
+		onViolation := licensePolicy.OnViolation
+		modulesLock.RUnlock()
+
+		if onViolation != nil {
+			onViolation(violation.module, violation.license)
+		}
+	}
+
+	return err
+}
+
+// registerModuleLocked is RegisterModule's implementation. It assumes
+// modulesLock is already held for writing.
+func registerModuleLocked(module Module) error {
 	genericModuleId := module.GenericId()
 	specificModuleId := module.SpecificId()
-	_, ok := registeredModulesById[genericModuleId][specificModuleId]
-	if ok {
-		return fmt.Errorf("id colision detected : %q / %q", genericModuleId, specificModuleId)
+
+	if _, ok := registeredModulesById[genericModuleId][specificModuleId]; ok {
+		return fmt.Errorf("%w : %q / %q", ErrIdCollision, genericModuleId, specificModuleId)
+	}
+	if _, ok := pendingModules[genericModuleId][specificModuleId]; ok {
+		return fmt.Errorf("%w : %q / %q", ErrIdCollision, genericModuleId, specificModuleId)
+	}
+
+	if license := module.Metadata().License; !licensePolicy.allows(license) {
+		return &licenseViolationError{module: module, license: license}
 	}
 
-	err := module.Register()
-	if err != nil {
+	if !dependenciesSatisfied(dependenciesOf(module)) {
+		if pendingModules[genericModuleId] == nil {
+			pendingModules[genericModuleId] = make(ModuleMap)
+		}
+		pendingModules[genericModuleId][specificModuleId] = module
+
+		return nil
+	}
+
+	if err := insertModuleLocked(module); err != nil {
+		return err
+	}
+
+	// Registering this module may have satisfied other pending modules'
+	// dependencies, so try to make progress on them too.
+	drainPending()
+
+	return nil
+}
+
+// insertModuleLocked calls module.Register() and, on success, adds it to
+// the registeredModulesByType and registeredModulesById maps, and
+// publishes a Registered event. It assumes modulesLock is already held for
+// writing and that the module's id has already been checked for
+// uniqueness.
+func insertModuleLocked(module Module) error {
+	if selfSetter, ok := module.(interface{ setSelf(Module) }); ok {
+		selfSetter.setSelf(module)
+	}
+
+	if err := module.Register(); err != nil {
 		return err
 	}
 
+	genericModuleId := module.GenericId()
+	specificModuleId := module.SpecificId()
 	moduleType := module.Type()
 
 	if registeredModulesByType[moduleType] == nil {
@@ -138,11 +242,49 @@ func RegisterModule(module Module) error {
 	registeredModulesByType[moduleType][genericModuleId][specificModuleId] = module
 	registeredModulesById[genericModuleId][specificModuleId] = module
 
+	publish(Registered, module)
+
 	return nil
 }
 
+// CascadeUnregister controls what UnregisterModule does when the module
+// being removed still has dependents (other registered modules whose
+// DependentModule.Dependencies() reference it). When false (the default),
+// UnregisterModule refuses and returns an error naming the dependents.
+// When true, it unregisters the dependents first.
+var CascadeUnregister bool
+
 // UnregisterModule unregisters the given module.
 func UnregisterModule(module Module) error {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	return unregisterModuleLocked(module)
+}
+
+// unregisterModuleLocked is UnregisterModule's implementation. It assumes
+// modulesLock is already held for writing.
+func unregisterModuleLocked(module Module) error {
+	dependents := findDependents(module)
+	if len(dependents) > 0 {
+		if !CascadeUnregister {
+			ids := make([]string, 0, len(dependents))
+			for _, dependent := range dependents {
+				ids = append(ids, fmt.Sprintf("%s/%s", dependent.GenericId(), dependent.SpecificId()))
+			}
+			sort.Strings(ids)
+
+			return fmt.Errorf("module %q/%q still has dependents : %v",
+				module.GenericId(), module.SpecificId(), ids)
+		}
+
+		for _, dependent := range dependents {
+			if err := unregisterModuleLocked(dependent); err != nil {
+				return err
+			}
+		}
+	}
+
 	moduleType := module.Type()
 	genericModuleId := module.GenericId()
 	specificModuleId := module.SpecificId()
@@ -170,6 +312,8 @@ func UnregisterModule(module Module) error {
 				delete(registeredModulesById, genericModuleId)
 			}
 
+			publish(Unregistered, module)
+
 			return nil
 		}
 	}
@@ -177,9 +321,14 @@ func UnregisterModule(module Module) error {
 	return fmt.Errorf("module not found")
 }
 
-// GetModulesByType returns a FullModuleMap with all modules of the given type.
+// GetModulesByType returns a FullModuleMap with all modules of the given
+// type. The returned map is a snapshot and safe to iterate even if modules
+// are concurrently registered or unregistered.
 func GetModulesByType(moduleType string) FullModuleMap {
-	return registeredModulesByType[moduleType]
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
+	return cloneFullModuleMap(registeredModulesByType[moduleType])
 }
 
 // GetModuleCountByType returns the number of registered modules of a specific
@@ -189,9 +338,13 @@ func GetModuleCountByType(moduleType string) int {
 }
 
 // GetModulesByGenericId returns a ModuleMap with all modules with the given
-// genericModuleId.
+// genericModuleId. The returned map is a snapshot and safe to iterate even
+// if modules are concurrently registered or unregistered.
 func GetModulesByGenericId(genericModuleId string) ModuleMap {
-	return registeredModulesById[genericModuleId]
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
+	return cloneModuleMap(registeredModulesById[genericModuleId])
 }
 
 // GetModuleCountByGenericId returns the number of registered modules with the
@@ -203,19 +356,30 @@ func GetModuleCountByGenericId(genericModuleId string) int {
 // GetModuleById returns the Module instance associated with the given
 // genericModuleId and SpecificModuleId.
 func GetModuleById(genericModuleId, specificModuleId string) Module {
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
 	return registeredModulesById[genericModuleId][specificModuleId]
 }
 
 // GetDefaultModuleByGenericId returns the default module represented by the
 // given genericModuleId. There may not be a default instance available.
 func GetDefaultModuleByGenericId(genericModuleId string) Module {
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
 	// Default module jas the empty string as the specificModuleId.
 	return registeredModulesById[genericModuleId][""]
 }
 
-// GetAllModules returns a ModuleMap containing all registered modules.
+// GetAllModules returns a FullModuleMap containing all registered modules.
+// The returned map is a snapshot and safe to iterate even if modules are
+// concurrently registered or unregistered.
 func GetAllModules() FullModuleMap {
-	return registeredModulesById
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
+	return cloneFullModuleMap(registeredModulesById)
 }
 
 // GetAllModulesCount returns the total number of registered modules.
@@ -232,3 +396,24 @@ func countFullModuleMap(fullModuleMap FullModuleMap) int {
 
 	return count
 }
+
+// cloneModuleMap returns a shallow copy of m.
+func cloneModuleMap(m ModuleMap) ModuleMap {
+	clone := make(ModuleMap, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+
+	return clone
+}
+
+// cloneFullModuleMap returns a shallow copy of m, including a shallow copy
+// of every ModuleMap it contains.
+func cloneFullModuleMap(m FullModuleMap) FullModuleMap {
+	clone := make(FullModuleMap, len(m))
+	for k, v := range m {
+		clone[k] = cloneModuleMap(v)
+	}
+
+	return clone
+}
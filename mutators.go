@@ -0,0 +1,205 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package modules
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Phase identifies a point in a module's lifecycle RunMutators can be
+// invoked at.
+type Phase int
+
+const (
+	PreRegister Phase = iota
+	PostRegister
+	PreConfigure
+	PostConfigure
+	PreReady
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PreRegister:
+		return "PreRegister"
+	case PostRegister:
+		return "PostRegister"
+	case PreConfigure:
+		return "PreConfigure"
+	case PostConfigure:
+		return "PostConfigure"
+	case PreReady:
+		return "PreReady"
+	default:
+		return "Unknown"
+	}
+}
+
+// MutatorContext is passed to a mutator function registered via
+// RegisterMutator, giving it access to the Module being processed and a
+// few helpers for common mutator patterns.
+type MutatorContext struct {
+	// Module is the module this invocation of the mutator applies to.
+	Module Module
+
+	// Parameters is Module.Parameters(), provided here for convenience.
+	Parameters *ParameterMap
+
+	disabled *bool
+}
+
+// CreateVariant creates and registers a new instance of ctx.Module with
+// the given specificId. It is implemented via Module.Duplicate.
+func (ctx MutatorContext) CreateVariant(specificId string) (Module, error) {
+	return ctx.Module.Duplicate(specificId)
+}
+
+// specificIdSetter is implemented by *GenericModule (and, by embedding, by
+// every Module built on top of it) to let Rename change SpecificId.
+type specificIdSetter interface {
+	setSpecificId(string)
+}
+
+// Rename unregisters ctx.Module and re-registers it under newSpecificId.
+// It only works for modules embedding *GenericModule, since Module does
+// not otherwise expose a way to change SpecificId.
+func (ctx MutatorContext) Rename(newSpecificId string) error {
+	setter, ok := ctx.Module.(specificIdSetter)
+	if !ok {
+		return fmt.Errorf("module %q/%q can not be renamed", ctx.Module.GenericId(), ctx.Module.SpecificId())
+	}
+
+	if err := UnregisterModule(ctx.Module); err != nil {
+		return err
+	}
+
+	setter.setSpecificId(newSpecificId)
+
+	return RegisterModule(ctx.Module)
+}
+
+// Disable marks ctx.Module as disabled for the remainder of the current
+// RunMutators call. Disabled modules are skipped by subsequent mutators in
+// that run, but are not unregistered.
+func (ctx MutatorContext) Disable() {
+	*ctx.disabled = true
+}
+
+// mutator is a named fn registered to run during a given Phase.
+type mutator struct {
+	name  string
+	phase Phase
+	fn    func(MutatorContext) error
+}
+
+var (
+	mutatorsLock sync.Mutex
+	mutators     []*mutator
+)
+
+// RegisterMutator registers fn to run, during RunMutators(phase), once for
+// every currently registered module. name identifies the mutator in error
+// messages.
+func RegisterMutator(name string, phase Phase, fn func(MutatorContext) error) {
+	mutatorsLock.Lock()
+	defer mutatorsLock.Unlock()
+
+	mutators = append(mutators, &mutator{name: name, phase: phase, fn: fn})
+}
+
+// RunMutators invokes every mutator registered for phase, once per
+// currently registered module, in deterministic (genericId, specificId)
+// order. It stops and returns an error identifying the offending mutator
+// and module as soon as one fails.
+func RunMutators(phase Phase) error {
+	targets := snapshotModulesForMutators()
+
+	mutatorsLock.Lock()
+	phaseMutators := make([]*mutator, 0, len(mutators))
+	for _, m := range mutators {
+		if m.phase == phase {
+			phaseMutators = append(phaseMutators, m)
+		}
+	}
+	mutatorsLock.Unlock()
+
+	for _, target := range targets {
+		disabled := false
+		ctx := MutatorContext{
+			Module:     target.module,
+			Parameters: target.module.Parameters(),
+			disabled:   &disabled,
+		}
+
+		for _, m := range phaseMutators {
+			if disabled {
+				break
+			}
+
+			if err := m.fn(ctx); err != nil {
+				return fmt.Errorf("mutator %q (phase %v) on module %q/%q : %w",
+					m.name, phase, target.genericId, target.specificId, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// mutatorTarget is a single (genericId, specificId, module) triple to run
+// phase mutators against.
+type mutatorTarget struct {
+	genericId  string
+	specificId string
+	module     Module
+}
+
+// snapshotModulesForMutators returns every currently registered module, in
+// deterministic (genericId, specificId) order, without holding modulesLock
+// while mutators run (they may themselves call RegisterModule or
+// UnregisterModule).
+func snapshotModulesForMutators() []mutatorTarget {
+	modulesLock.RLock()
+	defer modulesLock.RUnlock()
+
+	genericIds := make([]string, 0, len(registeredModulesById))
+	for genericId := range registeredModulesById {
+		genericIds = append(genericIds, genericId)
+	}
+	sort.Strings(genericIds)
+
+	var targets []mutatorTarget
+	for _, genericId := range genericIds {
+		moduleMap := registeredModulesById[genericId]
+
+		specificIds := make([]string, 0, len(moduleMap))
+		for specificId := range moduleMap {
+			specificIds = append(specificIds, specificId)
+		}
+		sort.Strings(specificIds)
+
+		for _, specificId := range specificIds {
+			targets = append(targets, mutatorTarget{
+				genericId:  genericId,
+				specificId: specificId,
+				module:     moduleMap[specificId],
+			})
+		}
+	}
+
+	return targets
+}
@@ -0,0 +1,193 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+// Package plugin loads modules out of Go plugins (".so" files built with
+// "go build -buildmode=plugin"). A plugin is expected to export an
+// "ModuleApiVersion int" symbol matching base_modules.ApiVersion plus
+// either a "Modules []base_modules.Module" symbol or a
+// "NewModules func() []base_modules.Module" constructor symbol.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+
+	base_modules "github.com/brunoga/go-modules"
+)
+
+const (
+	apiVersionSymbolName = "ModuleApiVersion"
+	modulesSymbolName    = "Modules"
+	newModulesSymbolName = "NewModules"
+)
+
+// VersionMismatchError is returned by LoadPlugin when a plugin's
+// ModuleApiVersion does not match base_modules.ApiVersion.
+type VersionMismatchError struct {
+	Path          string
+	PluginVersion int
+	WantVersion   int
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("plugin %q : api version %d does not match expected %d",
+		e.Path, e.PluginVersion, e.WantVersion)
+}
+
+// SymbolMissingError is returned by LoadPlugin when a plugin does not
+// export a required symbol.
+type SymbolMissingError struct {
+	Path   string
+	Symbol string
+}
+
+func (e *SymbolMissingError) Error() string {
+	return fmt.Sprintf("plugin %q : missing exported symbol %q", e.Path, e.Symbol)
+}
+
+// DuplicateIDError is returned by LoadPluginDir when a module loaded from
+// a plugin collides with an already registered generic id / specific id
+// pair.
+type DuplicateIDError struct {
+	Path       string
+	GenericId  string
+	SpecificId string
+}
+
+func (e *DuplicateIDError) Error() string {
+	return fmt.Sprintf("plugin %q : module %q / %q is already registered",
+		e.Path, e.GenericId, e.SpecificId)
+}
+
+// LoadPlugin opens the Go plugin at path, checks its ModuleApiVersion
+// against base_modules.ApiVersion and returns the Modules it exports. It
+// does not register them; callers are expected to pass each one to
+// base_modules.RegisterModule (LoadPluginDir does this for every plugin in
+// a directory).
+func LoadPlugin(path string) ([]base_modules.Module, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening plugin %q : %w", path, err)
+	}
+
+	if err := checkApiVersion(p, path); err != nil {
+		return nil, err
+	}
+
+	return lookupModules(p, path)
+}
+
+// checkApiVersion looks up the ModuleApiVersion symbol in p and compares
+// it against base_modules.ApiVersion.
+func checkApiVersion(p *plugin.Plugin, path string) error {
+	symbol, err := p.Lookup(apiVersionSymbolName)
+	if err != nil {
+		return &SymbolMissingError{Path: path, Symbol: apiVersionSymbolName}
+	}
+
+	version, ok := symbol.(*int)
+	if !ok {
+		return fmt.Errorf("plugin %q : %s has unexpected type %T", path, apiVersionSymbolName, symbol)
+	}
+
+	if *version != base_modules.ApiVersion {
+		return &VersionMismatchError{Path: path, PluginVersion: *version, WantVersion: base_modules.ApiVersion}
+	}
+
+	return nil
+}
+
+// lookupModules returns the Modules a plugin exports, preferring a
+// NewModules constructor over a Modules slice when both are present.
+func lookupModules(p *plugin.Plugin, path string) ([]base_modules.Module, error) {
+	if symbol, err := p.Lookup(newModulesSymbolName); err == nil {
+		newModules, ok := symbol.(func() []base_modules.Module)
+		if !ok {
+			return nil, fmt.Errorf("plugin %q : %s has unexpected type %T", path, newModulesSymbolName, symbol)
+		}
+
+		return newModules(), nil
+	}
+
+	symbol, err := p.Lookup(modulesSymbolName)
+	if err != nil {
+		return nil, &SymbolMissingError{Path: path, Symbol: modulesSymbolName}
+	}
+
+	modules, ok := symbol.(*[]base_modules.Module)
+	if !ok {
+		return nil, fmt.Errorf("plugin %q : %s has unexpected type %T", path, modulesSymbolName, symbol)
+	}
+
+	return *modules, nil
+}
+
+// LoadPluginDir calls LoadPlugin for every ".so" file directly inside dir
+// and registers every Module it returns via base_modules.RegisterModule.
+//
+// There is intentionally no option to watch dir and reload a plugin when
+// its ".so" changes : the standard library's plugin.Open caches a plugin
+// by path and always returns the original one for a path it has already
+// opened, so such a "reload" would just re-register the same stale
+// Modules (or fail with a duplicate id) instead of picking up new code.
+// Loading updated code requires building it to a new path and calling
+// LoadPlugin on that path instead.
+func LoadPluginDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading plugin directory %q : %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".so" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		if _, err := loadAndRegister(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadAndRegister loads the plugin at path and registers every Module it
+// returns, reporting a duplicate id as a DuplicateIDError.
+func loadAndRegister(path string) ([]base_modules.Module, error) {
+	modules, err := LoadPlugin(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, module := range modules {
+		if err := base_modules.RegisterModule(module); err != nil {
+			if errors.Is(err, base_modules.ErrIdCollision) {
+				return nil, &DuplicateIDError{
+					Path:       path,
+					GenericId:  module.GenericId(),
+					SpecificId: module.SpecificId(),
+				}
+			}
+
+			return nil, fmt.Errorf("registering module from plugin %q : %w", path, err)
+		}
+	}
+
+	return modules, nil
+}
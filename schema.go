@@ -0,0 +1,287 @@
+// Copyright 2013 Bruno Albuquerque (bga@bug-br.org.br).
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamType identifies the type a Param's value is coerced and validated
+// against.
+type ParamType int
+
+const (
+	String ParamType = iota
+	Int
+	Bool
+	Duration
+	Enum
+	Path
+	Secret
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Bool:
+		return "bool"
+	case Duration:
+		return "duration"
+	case Enum:
+		return "enum"
+	case Path:
+		return "path"
+	case Secret:
+		return "secret"
+	default:
+		return "unknown"
+	}
+}
+
+// Param describes a single configuration option a Module accepts.
+type Param struct {
+	Name        string
+	Type        ParamType
+	Default     any
+	Required    bool
+	Description string
+	Validate    func(any) error
+	EnumValues  []string
+}
+
+// ParameterSchema is the set of Params a Module accepts. It replaces
+// having to hand-write "required" checks and default handling in
+// Configure (as CompleteModule.Configure does) with a declarative
+// description that ParseParameterMap and ParseMap can validate and
+// coerce configuration against. See also the configio subpackage, which
+// decodes TOML/YAML documents and validates them against a
+// ParameterSchema via ParseMap.
+type ParameterSchema []Param
+
+// FieldError is a single Param's validation failure, as collected into a
+// ConfigError.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (fe FieldError) Error() string {
+	return fmt.Sprintf("%s : %v", fe.Field, fe.Err)
+}
+
+// ConfigError reports every field that failed validation while parsing
+// configuration against a ParameterSchema.
+type ConfigError struct {
+	Fields []FieldError
+}
+
+func (e *ConfigError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, fieldError := range e.Fields {
+		messages = append(messages, fieldError.Error())
+	}
+
+	return fmt.Sprintf("invalid configuration : %s", strings.Join(messages, "; "))
+}
+
+func (e *ConfigError) add(field string, err error) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Err: err})
+}
+
+// ParseParameterMap validates and coerces params (a ParameterMap, as
+// returned by Module.Parameters) against schema, applying defaults for
+// missing optional fields. It returns a ConfigError listing every
+// offending field if validation fails.
+func (schema ParameterSchema) ParseParameterMap(params *ParameterMap) (map[string]any, error) {
+	raw := make(map[string]string)
+	if params != nil {
+		raw = *params
+	}
+
+	configError := &ConfigError{}
+	result := make(map[string]any, len(schema))
+
+	for _, param := range schema {
+		stringValue, present := raw[param.Name]
+		if !present {
+			if param.Required {
+				configError.add(param.Name, fmt.Errorf("required parameter is missing"))
+				continue
+			}
+
+			schema.setValidated(result, configError, param, param.Default)
+			continue
+		}
+
+		value, err := coerce(param, stringValue)
+		if err != nil {
+			configError.add(param.Name, err)
+			continue
+		}
+
+		schema.setValidated(result, configError, param, value)
+	}
+
+	if len(configError.Fields) > 0 {
+		return nil, configError
+	}
+
+	return result, nil
+}
+
+// ParseMap validates and coerces values (already typed, e.g. decoded from
+// TOML or YAML - see the configio subpackage) against schema, applying
+// defaults for missing optional fields. Like ParseParameterMap, it runs
+// each present value through coerceValue, so an Enum value must still be
+// one of EnumValues and an Int/Bool/Duration value is accepted either
+// already typed or as a string. It returns a ConfigError listing every
+// offending field if validation fails.
+func (schema ParameterSchema) ParseMap(values map[string]any) (map[string]any, error) {
+	configError := &ConfigError{}
+	result := make(map[string]any, len(schema))
+
+	for _, param := range schema {
+		rawValue, present := values[param.Name]
+		if !present {
+			if param.Required {
+				configError.add(param.Name, fmt.Errorf("required parameter is missing"))
+				continue
+			}
+
+			schema.setValidated(result, configError, param, param.Default)
+			continue
+		}
+
+		value, err := coerceValue(param, rawValue)
+		if err != nil {
+			configError.add(param.Name, err)
+			continue
+		}
+
+		schema.setValidated(result, configError, param, value)
+	}
+
+	if len(configError.Fields) > 0 {
+		return nil, configError
+	}
+
+	return result, nil
+}
+
+// setValidated runs param.Validate (if set) against value and, if it
+// passes, stores value in result; otherwise it records the failure in
+// configError.
+func (schema ParameterSchema) setValidated(result map[string]any, configError *ConfigError, param Param, value any) {
+	if param.Validate != nil {
+		if err := param.Validate(value); err != nil {
+			configError.add(param.Name, err)
+			return
+		}
+	}
+
+	result[param.Name] = value
+}
+
+// coerce converts the string value of a ParameterMap entry to the type
+// param.Type declares.
+func coerce(param Param, value string) (any, error) {
+	switch param.Type {
+	case String, Path, Secret:
+		return value, nil
+	case Int:
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid int : %v", err)
+		}
+
+		return intValue, nil
+	case Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid bool : %v", err)
+		}
+
+		return boolValue, nil
+	case Duration:
+		durationValue, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid duration : %v", err)
+		}
+
+		return durationValue, nil
+	case Enum:
+		for _, enumValue := range param.EnumValues {
+			if value == enumValue {
+				return value, nil
+			}
+		}
+
+		return nil, fmt.Errorf("must be one of %v", param.EnumValues)
+	default:
+		return nil, fmt.Errorf("unsupported parameter type %v", param.Type)
+	}
+}
+
+// coerceValue is coerce's counterpart for already-typed values (as
+// ParseMap receives, e.g. decoded from TOML or YAML by the configio
+// subpackage). A value matching param.Type's natural Go type (int,
+// bool, time.Duration) is accepted as-is; a string is coerced the same
+// way coerce does, so callers that only have strings (or a format that
+// decodes everything as a string) still work.
+func coerceValue(param Param, value any) (any, error) {
+	if stringValue, ok := value.(string); ok {
+		return coerce(param, stringValue)
+	}
+
+	switch param.Type {
+	case String, Path, Secret:
+		return nil, fmt.Errorf("not a valid %s : %T", param.Type, value)
+	case Int:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			return int(v), nil
+		default:
+			return nil, fmt.Errorf("not a valid int : %T", value)
+		}
+	case Bool:
+		boolValue, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("not a valid bool : %T", value)
+		}
+
+		return boolValue, nil
+	case Duration:
+		durationValue, ok := value.(time.Duration)
+		if !ok {
+			return nil, fmt.Errorf("not a valid duration : %T", value)
+		}
+
+		return durationValue, nil
+	case Enum:
+		return nil, fmt.Errorf("not a valid enum value : %T", value)
+	default:
+		return nil, fmt.Errorf("unsupported parameter type %v", param.Type)
+	}
+}